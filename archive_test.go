@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestSafeJoinAllowsPathsInsideOutputDir(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"a.txt", "out/a.txt"},
+		{"sub/b.txt", "out/sub/b.txt"},
+	}
+
+	for _, c := range cases {
+		got, err := safeJoin("out", c.name)
+		if err != nil {
+			t.Fatalf("safeJoin(%q) returned unexpected error: %v", c.name, err)
+		}
+		if got != c.want {
+			t.Errorf("safeJoin(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSafeJoinRejectsPathTraversal(t *testing.T) {
+	cases := []string{
+		"../escape.txt",
+		"../../etc/passwd",
+		"sub/../../escape.txt",
+	}
+
+	for _, name := range cases {
+		if _, err := safeJoin("out", name); err == nil {
+			t.Errorf("safeJoin(%q) should have rejected the path, got nil error", name)
+		}
+	}
+}
+
+func TestSafeJoinRejectsSiblingDirWithSharedPrefix(t *testing.T) {
+	if _, err := safeJoin("out", "../out-evil/escape.txt"); err == nil {
+		t.Error("safeJoin should reject a sibling directory that merely shares a string prefix")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"testing"
+)
+
+func resetChecksumCache() {
+	checksumCacheMu.Lock()
+	checksumCacheList = list.New()
+	checksumCacheMap = make(map[checksumCacheKey]*list.Element)
+	checksumCacheMu.Unlock()
+}
+
+func TestChecksumCacheGetPutRoundTrip(t *testing.T) {
+	resetChecksumCache()
+
+	key := checksumCacheKey{Path: "/a.txt", Algo: "sha256", MTime: 1, Size: 10}
+	if _, ok := checksumCacheGet(key); ok {
+		t.Fatal("expected cache miss before any Put")
+	}
+
+	checksumCachePut(key, "digest-a")
+	digest, ok := checksumCacheGet(key)
+	if !ok || digest != "digest-a" {
+		t.Fatalf("expected cache hit with digest-a, got %q ok=%v", digest, ok)
+	}
+}
+
+func TestChecksumCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	resetChecksumCache()
+
+	for i := 0; i < checksumCacheCapacity; i++ {
+		key := checksumCacheKey{Path: fmt.Sprintf("/f%d.txt", i), Algo: "sha256", MTime: int64(i), Size: int64(i)}
+		checksumCachePut(key, fmt.Sprintf("digest-%d", i))
+	}
+
+	first := checksumCacheKey{Path: "/f0.txt", Algo: "sha256", MTime: 0, Size: 0}
+	// 访问一次最旧的条目，使其成为最近使用，不应被下一次 Put 驱逐
+	if _, ok := checksumCacheGet(first); !ok {
+		t.Fatal("expected first entry to still be cached before eviction")
+	}
+
+	overflowKey := checksumCacheKey{Path: "/overflow.txt", Algo: "sha256", MTime: 999, Size: 999}
+	checksumCachePut(overflowKey, "digest-overflow")
+
+	if _, ok := checksumCacheGet(first); !ok {
+		t.Fatal("most recently accessed entry should survive eviction")
+	}
+
+	second := checksumCacheKey{Path: "/f1.txt", Algo: "sha256", MTime: 1, Size: 1}
+	if _, ok := checksumCacheGet(second); ok {
+		t.Fatal("least recently used entry should have been evicted")
+	}
+
+	if checksumCacheList.Len() != checksumCacheCapacity {
+		t.Fatalf("expected cache to stay at capacity %d, got %d", checksumCacheCapacity, checksumCacheList.Len())
+	}
+}
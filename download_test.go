@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestBuildChunksCoversWholeFileWithoutOverlap(t *testing.T) {
+	chunks := buildChunks(1000, 3)
+
+	if len(chunks) == 0 {
+		t.Fatal("expected at least one chunk")
+	}
+	if chunks[0].From != 0 {
+		t.Fatalf("first chunk should start at 0, got %d", chunks[0].From)
+	}
+	if chunks[len(chunks)-1].To != 999 {
+		t.Fatalf("last chunk should end at 999, got %d", chunks[len(chunks)-1].To)
+	}
+	for i := 1; i < len(chunks); i++ {
+		if chunks[i].From != chunks[i-1].To+1 {
+			t.Fatalf("chunk %d does not immediately follow chunk %d: %+v / %+v", i, i-1, chunks[i-1], chunks[i])
+		}
+	}
+}
+
+func TestBuildChunksFallsBackToSingleChunkWhenTooSmallToSplit(t *testing.T) {
+	chunks := buildChunks(2, 8)
+	if len(chunks) != 1 {
+		t.Fatalf("expected a single chunk when size < concurrency, got %d: %+v", len(chunks), chunks)
+	}
+	if chunks[0].From != 0 || chunks[0].To != 1 {
+		t.Fatalf("expected chunk covering [0,1], got %+v", chunks[0])
+	}
+}
+
+func TestChunksComplete(t *testing.T) {
+	complete := []ChunkState{{From: 0, To: 9, Downloaded: 10}, {From: 10, To: 19, Downloaded: 10}}
+	if !chunksComplete(complete) {
+		t.Fatal("expected chunks to be reported complete")
+	}
+
+	incomplete := []ChunkState{{From: 0, To: 9, Downloaded: 10}, {From: 10, To: 19, Downloaded: 5}}
+	if chunksComplete(incomplete) {
+		t.Fatal("expected chunks to be reported incomplete")
+	}
+}
@@ -1,23 +1,42 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/cheggaaa/pb/v3"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cobra"
+	"golang.org/x/time/rate"
+	"hash"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // 服务端变量
 var (
 	port     string
 	rootPath string
+	authFile string
 )
 
 // 客户端变量
@@ -26,16 +45,86 @@ var (
 	savePath    string
 	concurrency int
 	resumeFile  string
+	verifyAlgo  string
+
+	uploadResumeFile string
+
+	silentMode bool
+	noProgress bool
+
+	authToken      string
+	rateLimitBytes int64
+
+	manifestFile string
+	syncDryRun   bool
+	syncDelete   bool
 )
 
 // 客户端数据结构
 type FileInfo struct {
-	Path string `json:"path"`
-	Size int64  `json:"size"`
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	MTime int64  `json:"mtime"`
+}
+
+// manifestEntry 记录 sync 命令上一次看到的服务器端文件的路径、大小与修改时间。
+// Path 是相对于本次 sync 的 remote-dir 的路径（用于和本地扫描结果比对/删除），
+// ServerPath 是相对于服务器 --path 根目录的完整路径（用于 /download 请求）
+type manifestEntry struct {
+	Path       string `json:"path"`
+	ServerPath string `json:"server_path"`
+	Size       int64  `json:"size"`
+	MTime      int64  `json:"mtime"`
+}
+
+// syncManifest 持久化到 manifestFile，保存上一次 sync 时服务器的 ETag 与文件清单，
+// 使后续运行在服务器内容未变化（/list 返回 304）时复用缓存的文件清单，而不必重新接收清单；
+// 服务器端仍会遍历目录以计算 ETag
+type syncManifest struct {
+	ETag  string                   `json:"etag"`
+	Files map[string]manifestEntry `json:"files"`
+}
+
+// ChunkState 记录单个分片的下载范围及已完成的字节数，用于断点续传
+type ChunkState struct {
+	From       int64 `json:"from"`
+	To         int64 `json:"to"`
+	Downloaded int64 `json:"downloaded"`
 }
 
 type DownloadState struct {
-	Files map[string]int64 `json:"files"`
+	Files    map[string][]ChunkState `json:"files"`              // 文件路径 -> 分片状态
+	Verified map[string]string       `json:"verified,omitempty"` // 文件路径 -> "algo:hex" 已验证摘要
+}
+
+// chunkBufSize 是每次从响应体读取并写入目标文件的缓冲区大小
+const chunkBufSize = 32 * 1024
+
+// stateSaveInterval 控制 resume 状态落盘的最小间隔，避免对每个 32KB 读取都同步重写整个 resume 文件
+const stateSaveInterval = 2 * time.Second
+
+// maxVerifyRetries 是 --verify 校验失败后允许重新下载的次数
+const maxVerifyRetries = 3
+
+// maxUploadSessionRetries 是上传会话失效（如服务器重启导致内存中的 UploadID 丢失）后
+// 允许重新 initUpload 的次数
+const maxUploadSessionRetries = 3
+
+// errUploadSessionExpired 表示 /upload/chunk/:id 返回 404，即服务器已不认识该 UploadID，
+// 调用方应丢弃本地缓存的上传进度并重新 initUpload
+var errUploadSessionExpired = errors.New("上传会话已失效")
+
+// UploadFileState 记录单个文件分片上传的进度，持久化到 uploadResumeFile 以支持断点续传
+type UploadFileState struct {
+	UploadID  string       `json:"upload_id"`
+	ChunkSize int64        `json:"chunk_size"`
+	Size      int64        `json:"size"`
+	SHA256    string       `json:"sha256"`
+	Chunks    map[int]bool `json:"chunks"`
+}
+
+type UploadState struct {
+	Files map[string]UploadFileState `json:"files"` // 远程路径 -> 上传进度
 }
 
 var rootCmd = &cobra.Command{
@@ -62,6 +151,7 @@ var downloadCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		downloadFile(args[0])
+		verifyAndRetry(args[0])
 	},
 }
 
@@ -86,16 +176,72 @@ var listCmd = &cobra.Command{
 	},
 }
 
+// 归档下载参数
+var (
+	archiveFormat  string
+	archiveExtract bool
+)
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive [dir_path]",
+	Short: "下载整个目录的归档文件（tar/tar.gz/zip）",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		downloadArchive(args[0])
+	},
+}
+
+var uploadCmd = &cobra.Command{
+	Use:   "upload [local_path] [remote_path]",
+	Short: "上传单个文件",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := uploadFile(args[0], args[1]); err != nil {
+			fmt.Printf("上传失败: %v\n", err)
+		}
+	},
+}
+
+var uploadDirCmd = &cobra.Command{
+	Use:   "uploaddir [local_dir] [remote_dir]",
+	Short: "递归上传整个目录",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		uploadDirectory(args[0], args[1])
+	},
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync [remote_dir] [local_dir]",
+	Short: "将服务器目录镜像到本地目录（类似 rsync --delete）",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		syncDirectory(args[0], args[1])
+	},
+}
+
 func init() {
 	// 服务端参数
 	serverCmd.PersistentFlags().StringVarP(&port, "port", "p", "8080", "服务器端口")
 	serverCmd.PersistentFlags().StringVarP(&rootPath, "path", "d", ".", "根目录路径")
+	serverCmd.PersistentFlags().StringVarP(&authFile, "auth-file", "a", "", "访问令牌/限流配置文件（JSON），为空则不启用鉴权")
 
 	// 客户端参数
 	clientCmd.PersistentFlags().StringVarP(&serverURL, "server", "s", "http://localhost:8080", "服务器URL")
 	clientCmd.PersistentFlags().StringVarP(&savePath, "output", "o", ".", "保存路径")
 	clientCmd.PersistentFlags().IntVarP(&concurrency, "concurrency", "c", 5, "下载并发数")
 	clientCmd.PersistentFlags().StringVarP(&resumeFile, "resume", "r", ".download_state.json", "断点续传状态文件")
+	clientCmd.PersistentFlags().StringVarP(&verifyAlgo, "verify", "", "", "下载后校验文件完整性，可选 sha256 或 md5")
+	clientCmd.PersistentFlags().StringVarP(&uploadResumeFile, "upload-resume", "", ".upload_state.json", "上传断点续传状态文件")
+	clientCmd.PersistentFlags().BoolVar(&silentMode, "silent", false, "静默模式，不显示进度条或周期性进度日志")
+	clientCmd.PersistentFlags().BoolVar(&noProgress, "no-progress", false, "禁用进度条，改为周期性打印进度日志")
+	clientCmd.PersistentFlags().StringVar(&authToken, "token", "", "访问令牌，通过 Authorization: Bearer 请求头发送")
+	clientCmd.PersistentFlags().Int64Var(&rateLimitBytes, "rate-limit", 0, "下载限速（字节/秒），0 表示不限速")
+	clientCmd.PersistentFlags().StringVar(&manifestFile, "manifest", ".fileshare_manifest.json", "sync 命令的远程清单缓存文件")
+	archiveCmd.Flags().StringVar(&archiveFormat, "format", "tar.gz", "归档格式: tar、tar.gz 或 zip")
+	archiveCmd.Flags().BoolVar(&archiveExtract, "extract", false, "下载后直接解包到 --output 目录，而非保存归档文件")
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "只打印将要执行的操作，不实际下载或删除")
+	syncCmd.Flags().BoolVar(&syncDelete, "delete", false, "删除本地存在但服务器上已不存在的文件")
 
 	// 添加命令
 	rootCmd.AddCommand(serverCmd)
@@ -103,6 +249,19 @@ func init() {
 	clientCmd.AddCommand(downloadCmd)
 	clientCmd.AddCommand(downloadDirCmd)
 	clientCmd.AddCommand(listCmd)
+	clientCmd.AddCommand(archiveCmd)
+	clientCmd.AddCommand(uploadCmd)
+	clientCmd.AddCommand(uploadDirCmd)
+	clientCmd.AddCommand(syncCmd)
+}
+
+// isWithinRoot 判断 fullPath 是否确实位于 root 目录内部，而不只是字符串前缀相同——
+// 例如 root 为 /srv/share 时，/srv/share-evil 与其共享字符串前缀但并非其子路径，
+// 不应被视为合法
+func isWithinRoot(fullPath, root string) bool {
+	root = filepath.Clean(root)
+	fullPath = filepath.Clean(fullPath)
+	return fullPath == root || strings.HasPrefix(fullPath, root+string(os.PathSeparator))
 }
 
 // 服务端函数
@@ -113,7 +272,24 @@ func startServer() {
 		return
 	}
 
+	uploadTempPath := filepath.Join(absPath, ".uploads")
+	if err := os.MkdirAll(uploadTempPath, 0755); err != nil {
+		fmt.Printf("创建上传临时目录失败: %v\n", err)
+		return
+	}
+
+	if authFile != "" {
+		cfg, err := loadAuthConfig(authFile)
+		if err != nil {
+			fmt.Printf("加载鉴权配置失败: %v\n", err)
+			return
+		}
+		authConfig = cfg
+	}
+
 	r := gin.Default()
+	r.Use(metricsMiddleware)
+	r.Use(authMiddleware)
 
 	// 处理单个文件下载
 	r.GET("/download/*path", func(c *gin.Context) {
@@ -145,9 +321,18 @@ func startServer() {
 			return
 		}
 
-		c.Header("Content-Length", fmt.Sprintf("%d", info.Size()))
-		c.Writer.Header().Set("Content-Length", fmt.Sprintf("%d", info.Size()))
+		// 只有非 Range 请求才需要强制设置完整文件大小，
+		// 否则会与 http.ServeFile 为 206 响应计算出的 Content-Range/Content-Length 冲突
+		if c.GetHeader("Range") == "" {
+			c.Header("Content-Length", fmt.Sprintf("%d", info.Size()))
+		}
+
+		atomic.AddInt64(&activeTransfers, 1)
+		defer atomic.AddInt64(&activeTransfers, -1)
 		http.ServeFile(c.Writer, c.Request, fullPath)
+		if c.Writer.Size() > 0 {
+			atomic.AddInt64(&bytesServedTotal, int64(c.Writer.Size()))
+		}
 	})
 
 	// 处理目录列表
@@ -180,10 +365,9 @@ func startServer() {
 			return
 		}
 
-		var files []struct {
-			Path string `json:"path"`
-			Size int64  `json:"size"`
-		}
+		checksumAlgo := c.Query("checksum")
+
+		var files []listEntry
 
 		err = filepath.Walk(fullPath, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
@@ -191,13 +375,17 @@ func startServer() {
 			}
 			relPath, _ := filepath.Rel(absPath, path)
 			if !info.IsDir() {
-				files = append(files, struct {
-					Path string `json:"path"`
-					Size int64  `json:"size"`
-				}{
-					Path: relPath,
-					Size: info.Size(),
-				})
+				entry := listEntry{
+					Path:  relPath,
+					Size:  info.Size(),
+					MTime: info.ModTime().Unix(),
+				}
+				if checksumAlgo != "" {
+					if digest, _, err := computeFileChecksum(path, checksumAlgo); err == nil {
+						entry.Checksum = digest
+					}
+				}
+				files = append(files, entry)
 			}
 			return nil
 		})
@@ -207,209 +395,2143 @@ func startServer() {
 			return
 		}
 
+		etag := fmt.Sprintf("%q", computeManifestETag(files))
+		if c.GetHeader("If-None-Match") == etag {
+			c.Header("ETag", etag)
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		c.Header("ETag", etag)
 		c.JSON(http.StatusOK, gin.H{"files": files})
 	})
 
-	// 设置 gin 为发布模式
-	gin.SetMode(gin.ReleaseMode)
-	fmt.Printf("服务器启动在端口 %s，服务目录：%s\n", port, absPath)
-	r.Run(":" + port)
-}
+	// 处理校验和计算
+	r.GET("/checksum/*path", func(c *gin.Context) {
+		filePath := c.Param("path")
+		filePath = filePath[1:]
+		decodedPath, err := url.QueryUnescape(filePath)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的文件路径"})
+			return
+		}
 
-// 客户端函数
-func loadDownloadState() DownloadState {
-	state := DownloadState{
-		Files: make(map[string]int64),
-	}
-	data, err := os.ReadFile(resumeFile)
-	if err == nil {
-		json.Unmarshal(data, &state)
-	}
-	return state
-}
+		fullPath := filepath.Join(absPath, decodedPath)
 
-func saveDownloadState(state DownloadState) {
-	data, err := json.Marshal(state)
-	if err == nil {
-		os.WriteFile(resumeFile, data, 0644)
-	}
-}
+		// 安全检查：确保路径不会超出根目录
+		if !strings.HasPrefix(fullPath, absPath) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "访问被拒绝"})
+			return
+		}
 
-func downloadFile(filePath string) {
-	state := loadDownloadState()
-	
-	encodedPath := url.PathEscape(filePath)
-	url := fmt.Sprintf("%s/download/%s", serverURL, encodedPath)
-	
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		fmt.Printf("创建请求失败: %v\n", err)
-		return
-	}
-	
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("获取文件失败: %v\n", err)
-		return
-	}
-	defer resp.Body.Close()
+		algo := c.DefaultQuery("algo", "sha256")
+		digest, size, err := computeFileChecksum(fullPath, algo)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("服务器返回错误状态码: %d\n", resp.StatusCode)
-		return
-	}
+		c.JSON(http.StatusOK, gin.H{"algo": algo, "hex": digest, "size": size})
+	})
 
-	totalSize := resp.ContentLength
-	if totalSize <= 0 {
-		fmt.Printf("警告: 无法获取文件 %s 的大小，将继续下载\n", filePath)
-	} else {
-		fmt.Printf("开始下载: %s (大小: %.2f MB)\n", filePath, float64(totalSize)/1024/1024)
-	}
+	// 处理整目录归档下载
+	r.GET("/archive/*path", func(c *gin.Context) {
+		dirPath := c.Param("path")
+		dirPath = dirPath[1:]
+		decodedPath, err := url.QueryUnescape(dirPath)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的目录路径"})
+			return
+		}
 
-	saveDir := filepath.Join(savePath, filepath.Dir(filePath))
-	err = os.MkdirAll(saveDir, 0755)
-	if err != nil {
-		fmt.Printf("创建目录失败: %v\n", err)
-		return
-	}
+		fullPath := filepath.Join(absPath, decodedPath)
 
-	fileName := filepath.Join(savePath, filePath)
-	if info, err := os.Stat(fileName); err == nil {
-		if totalSize > 0 && info.Size() == totalSize {
-			fmt.Printf("文件 %s 已存在且完整，跳过下载\n", filePath)
+		// 安全检查：确保路径不会超出根目录
+		if !strings.HasPrefix(fullPath, absPath) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "访问被拒绝"})
 			return
 		}
-	}
-	
-	out, err := os.Create(fileName)
-	if err != nil {
-		fmt.Printf("创建文件失败: %v\n", err)
-		return
-	}
-	defer out.Close()
 
-	written, err := io.Copy(out, resp.Body)
-	if err != nil {
-		fmt.Printf("保存文件失败: %v\n", err)
-		return
-	}
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "目录未找到"})
+			return
+		}
+		if !info.IsDir() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不是目录"})
+			return
+		}
 
-	if totalSize > 0 && written != totalSize {
-		fmt.Printf("警告: 文件大小不匹配，预期 %.2f MB，实际 %.2f MB\n", 
-			float64(totalSize)/1024/1024, 
-			float64(written)/1024/1024)
-		return
-	}
+		format := c.DefaultQuery("format", "tar.gz")
+		archiveName := filepath.Base(fullPath)
 
-	state.Files[filePath] = written
-	saveDownloadState(state)
-	fmt.Printf("成功下载: %s (%.2f MB)\n", fileName, float64(written)/1024/1024)
-}
+		atomic.AddInt64(&activeTransfers, 1)
+		defer atomic.AddInt64(&activeTransfers, -1)
+		defer func() {
+			if c.Writer.Size() > 0 {
+				atomic.AddInt64(&bytesServedTotal, int64(c.Writer.Size()))
+			}
+		}()
 
-func downloadDirectory(dirPath string) {
-	encodedPath := url.PathEscape(dirPath)
-	url := fmt.Sprintf("%s/list/%s", serverURL, encodedPath)
-	
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		fmt.Printf("创建请求失败: %v\n", err)
-		return
-	}
-	
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("获取目录列表失败: %v\n", err)
-		return
-	}
-	defer resp.Body.Close()
+		switch format {
+		case "zip":
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", archiveName))
+			c.Header("Content-Type", "application/zip")
+			if err := streamZipArchive(c.Writer, absPath, fullPath); err != nil {
+				fmt.Printf("打包 zip 归档失败: %v\n", err)
+			}
+		case "tar":
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.tar", archiveName))
+			c.Header("Content-Type", "application/x-tar")
+			if err := streamTarArchive(c.Writer, absPath, fullPath, false); err != nil {
+				fmt.Printf("打包 tar 归档失败: %v\n", err)
+			}
+		case "tar.gz", "":
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.tar.gz", archiveName))
+			c.Header("Content-Type", "application/gzip")
+			if err := streamTarArchive(c.Writer, absPath, fullPath, true); err != nil {
+				fmt.Printf("打包 tar.gz 归档失败: %v\n", err)
+			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的归档格式"})
+		}
+	})
 
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("错误: 服务器返回状态码 %d\n", resp.StatusCode)
-		return
-	}
+	// 初始化一次分片续传上传会话
+	r.POST("/upload/init", func(c *gin.Context) {
+		var req struct {
+			Path      string `json:"path"`
+			Size      int64  `json:"size"`
+			SHA256    string `json:"sha256"`
+			ChunkSize int64  `json:"chunk_size"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求体"})
+			return
+		}
 
-	var result struct {
-		Files []FileInfo `json:"files"`
-	}
-	err = json.NewDecoder(resp.Body).Decode(&result)
-	if err != nil {
-		fmt.Printf("解析响应失败: %v\n", err)
-		return
-	}
+		fullPath := filepath.Join(absPath, req.Path)
+		if !isWithinRoot(fullPath, absPath) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "访问被拒绝"})
+			return
+		}
+		if req.ChunkSize <= 0 {
+			req.ChunkSize = defaultUploadChunkSize
+		}
 
-	if len(result.Files) == 0 {
-		fmt.Printf("目录 %s 为空或不存在\n", dirPath)
-		return
-	}
+		tempFile, err := os.CreateTemp(uploadTempPath, "upload-*.part")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tempFile.Truncate(req.Size); err != nil {
+			tempFile.Close()
+			os.Remove(tempFile.Name())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
-	tasks := make(chan FileInfo, len(result.Files))
-	var wg sync.WaitGroup
+		uploadID, err := generateUploadID()
+		if err != nil {
+			tempFile.Close()
+			os.Remove(tempFile.Name())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
-	for i := 0; i < concurrency; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for file := range tasks {
-				downloadFile(file.Path)
-			}
-		}()
-	}
+		session := &uploadSession{
+			path:      req.Path,
+			size:      req.Size,
+			sha256:    req.SHA256,
+			chunkSize: req.ChunkSize,
+			tempFile:  tempFile,
+		}
 
-	for _, file := range result.Files {
-		tasks <- file
-	}
-	close(tasks)
+		uploadSessionsMu.Lock()
+		uploadSessions[uploadID] = session
+		uploadSessionsMu.Unlock()
 
-	wg.Wait()
-	fmt.Printf("目录下载完成: %s\n", dirPath)
-}
+		c.JSON(http.StatusOK, gin.H{"upload_id": uploadID, "chunk_size": req.ChunkSize})
+	})
 
-func listServerContent(dirPath string) {
-	encodedPath := url.PathEscape(dirPath)
-	url := fmt.Sprintf("%s/list/%s", serverURL, encodedPath)
-	
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		fmt.Printf("创建请求失败: %v\n", err)
-		return
-	}
-	
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("获取目录列表失败: %v\n", err)
-		return
-	}
-	defer resp.Body.Close()
+	// 写入指定分片，按 index*chunk_size 定位到稀疏临时文件中的偏移
+	r.PUT("/upload/chunk/:id", func(c *gin.Context) {
+		id := c.Param("id")
+		index, err := strconv.Atoi(c.Query("index"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分片序号"})
+			return
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("错误: 服务器返回状态码 %d\n", resp.StatusCode)
-		return
-	}
+		uploadSessionsMu.Lock()
+		session, ok := uploadSessions[id]
+		uploadSessionsMu.Unlock()
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "上传会话不存在"})
+			return
+		}
+
+		session.mu.Lock()
+		defer session.mu.Unlock()
+
+		written, err := writeChunkAt(session.tempFile, c.Request.Body, int64(index)*session.chunkSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"index": index, "received": written})
+	})
+
+	// 校验整体大小与 sha256，通过后原子改名到目标路径
+	r.POST("/upload/complete/:id", func(c *gin.Context) {
+		id := c.Param("id")
+
+		uploadSessionsMu.Lock()
+		session, ok := uploadSessions[id]
+		if ok {
+			delete(uploadSessions, id)
+		}
+		uploadSessionsMu.Unlock()
+
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "上传会话不存在"})
+			return
+		}
+
+		session.mu.Lock()
+		defer session.mu.Unlock()
+
+		tempName := session.tempFile.Name()
+		session.tempFile.Close()
+
+		info, err := os.Stat(tempName)
+		if err != nil || (session.size > 0 && info.Size() != session.size) {
+			os.Remove(tempName)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "文件大小不匹配"})
+			return
+		}
+
+		if session.sha256 != "" {
+			digest, _, err := computeFileChecksum(tempName, "sha256")
+			if err != nil || digest != session.sha256 {
+				os.Remove(tempName)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "校验和不匹配"})
+				return
+			}
+		}
+
+		targetPath := filepath.Join(absPath, session.path)
+		if !isWithinRoot(targetPath, absPath) {
+			os.Remove(tempName)
+			c.JSON(http.StatusForbidden, gin.H{"error": "访问被拒绝"})
+			return
+		}
+
+		if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+			os.Remove(tempName)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := os.Rename(tempName, targetPath); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"path": session.path, "size": info.Size()})
+	})
+
+	// 简单的 multipart 上传，使用独立的 /upload/file 前缀以避免与上面的静态路由
+	// 在 gin 路由树中发生通配符冲突
+	r.POST("/upload/file/*path", func(c *gin.Context) {
+		filePath := c.Param("path")
+		filePath = filePath[1:]
+		decodedPath, err := url.QueryUnescape(filePath)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的文件路径"})
+			return
+		}
+
+		fullPath := filepath.Join(absPath, decodedPath)
+		if !isWithinRoot(fullPath, absPath) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "访问被拒绝"})
+			return
+		}
+
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "缺少上传文件"})
+			return
+		}
+
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := c.SaveUploadedFile(fileHeader, fullPath); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"path": decodedPath, "size": fileHeader.Size})
+	})
+
+	// 暴露 Prometheus 文本格式的运行指标
+	r.GET("/metrics", func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4")
+		c.String(http.StatusOK, renderMetrics())
+	})
+
+	// 设置 gin 为发布模式
+	gin.SetMode(gin.ReleaseMode)
+	fmt.Printf("服务器启动在端口 %s，服务目录：%s\n", port, absPath)
+	r.Run(":" + port)
+}
+
+// listEntry 是 /list 接口返回的单个文件条目，mtime 与 size 用于 sync 命令的清单比对
+type listEntry struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	MTime    int64  `json:"mtime"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// computeManifestETag 对 (path,size,mtime) 三元组序列求摘要，作为 /list 响应的 ETag，
+// 与 checksum 查询参数无关，便于 sync 命令通过 If-None-Match 复用本地缓存的清单
+func computeManifestETag(files []listEntry) string {
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s:%d:%d\n", f.Path, f.Size, f.MTime)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// checksumCacheKey 用 (路径, mtime, size, 算法) 标识一次校验和计算结果
+type checksumCacheKey struct {
+	Path  string
+	Algo  string
+	MTime int64
+	Size  int64
+}
+
+// checksumCacheCapacity 是内存 LRU 缓存允许保留的摘要条目上限
+const checksumCacheCapacity = 1024
+
+var (
+	checksumCacheMu   sync.Mutex
+	checksumCacheList = list.New()
+	checksumCacheMap  = make(map[checksumCacheKey]*list.Element)
+)
+
+// 服务端运行指标，通过 /metrics 以 Prometheus 文本格式暴露
+var (
+	bytesServedTotal int64
+	activeTransfers  int64
+
+	requestCountMu   sync.Mutex
+	requestCountPath = make(map[string]int64)
+)
+
+// metricsMiddleware 按匹配到的路由模板统计请求次数
+func metricsMiddleware(c *gin.Context) {
+	c.Next()
+
+	path := c.FullPath()
+	if path == "" {
+		return
+	}
+
+	requestCountMu.Lock()
+	requestCountPath[path]++
+	requestCountMu.Unlock()
+}
+
+// renderMetrics 按 Prometheus 文本格式渲染当前的服务端运行指标
+func renderMetrics() string {
+	var b strings.Builder
+
+	fmt.Fprintln(&b, "# HELP fileshare_bytes_served_total Total bytes served by the file server")
+	fmt.Fprintln(&b, "# TYPE fileshare_bytes_served_total counter")
+	fmt.Fprintf(&b, "fileshare_bytes_served_total %d\n", atomic.LoadInt64(&bytesServedTotal))
+
+	fmt.Fprintln(&b, "# HELP fileshare_active_transfers Number of in-flight file/archive transfers")
+	fmt.Fprintln(&b, "# TYPE fileshare_active_transfers gauge")
+	fmt.Fprintf(&b, "fileshare_active_transfers %d\n", atomic.LoadInt64(&activeTransfers))
+
+	fmt.Fprintln(&b, "# HELP fileshare_requests_total Total requests received, labeled by route path")
+	fmt.Fprintln(&b, "# TYPE fileshare_requests_total counter")
+	requestCountMu.Lock()
+	for path, count := range requestCountPath {
+		fmt.Fprintf(&b, "fileshare_requests_total{path=%q} %d\n", path, count)
+	}
+	requestCountMu.Unlock()
+
+	return b.String()
+}
+
+// authEntry 描述单个访问令牌的限流/限速/路径授权配置，来自 --auth-file 指向的 JSON
+type authEntry struct {
+	RateBytesPerSec float64 `json:"rate_bytes_per_sec"`
+	MaxConcurrent   int     `json:"max_concurrent"`
+	PathPrefix      string  `json:"path_prefix"`
+}
+
+// authConfig 为空表示未启用鉴权，此时 authMiddleware 直接放行所有请求
+var (
+	authConfig map[string]authEntry
+
+	authActiveMu sync.Mutex
+	authActive   = make(map[string]int)
+
+	authLimitersMu sync.Mutex
+	authLimiters   = make(map[string]*rate.Limiter)
+)
+
+// tokenRateLimiter 返回 token 对应的共享 *rate.Limiter，不存在则按配置创建并缓存。
+// 必须在同一 token 的所有并发请求间共享同一个 limiter，否则每个并发连接各自拥有
+// 独立的满速度 limiter，聚合吞吐会随并发数线性放大，而不是被限制在配置速率之内
+func tokenRateLimiter(token string, entry authEntry) *rate.Limiter {
+	authLimitersMu.Lock()
+	defer authLimitersMu.Unlock()
+	if limiter, ok := authLimiters[token]; ok {
+		return limiter
+	}
+	limiter := rate.NewLimiter(rate.Limit(entry.RateBytesPerSec), int(entry.RateBytesPerSec))
+	authLimiters[token] = limiter
+	return limiter
+}
+
+// loadAuthConfig 读取 --auth-file 指向的 JSON，格式为 {token: {rate_bytes_per_sec, max_concurrent, path_prefix}}
+func loadAuthConfig(path string) (map[string]authEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg map[string]authEntry
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// authMiddleware 校验 Authorization: Bearer 令牌，按令牌配置强制路径前缀与并发上限，
+// 并在配置了限速时用 rateLimitedWriter 包裹响应体
+func authMiddleware(c *gin.Context) {
+	if len(authConfig) == 0 {
+		c.Next()
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	entry, ok := authConfig[token]
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的访问令牌"})
+		c.Abort()
+		return
+	}
+
+	if entry.PathPrefix != "" && !strings.HasPrefix(c.Request.URL.Path, entry.PathPrefix) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "该令牌无权访问此路径"})
+		c.Abort()
+		return
+	}
+
+	if entry.MaxConcurrent > 0 {
+		authActiveMu.Lock()
+		if authActive[token] >= entry.MaxConcurrent {
+			authActiveMu.Unlock()
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "并发请求数已达上限"})
+			c.Abort()
+			return
+		}
+		authActive[token]++
+		authActiveMu.Unlock()
+		defer func() {
+			authActiveMu.Lock()
+			authActive[token]--
+			authActiveMu.Unlock()
+		}()
+	}
+
+	if entry.RateBytesPerSec > 0 {
+		limiter := tokenRateLimiter(token, entry)
+		c.Writer = &rateLimitedWriter{ResponseWriter: c.Writer, limiter: limiter, ctx: c.Request.Context()}
+	}
+
+	c.Next()
+}
+
+// rateLimitedWriter 包裹 gin.ResponseWriter，按令牌配置的速率限制每次 Write 的吞吐量
+type rateLimitedWriter struct {
+	gin.ResponseWriter
+	limiter *rate.Limiter
+	ctx     context.Context
+}
+
+// waitRateLimit 分批调用 limiter.WaitN，每批不超过 limiter 的 burst 大小。
+// io.Copy/chunkBufSize 等上游通常一次性传入远大于 burst（等于配置速率）的字节数，
+// 而 WaitN 在 n > burst 时会直接返回错误而不等待，因此必须按 burst 拆分才能真正限速
+func waitRateLimit(ctx context.Context, limiter *rate.Limiter, n int) error {
+	burst := limiter.Burst()
+	if burst <= 0 {
+		burst = n
+	}
+	for n > 0 {
+		take := n
+		if take > burst {
+			take = burst
+		}
+		if err := limiter.WaitN(ctx, take); err != nil {
+			return err
+		}
+		n -= take
+	}
+	return nil
+}
+
+func (w *rateLimitedWriter) Write(p []byte) (int, error) {
+	burst := w.limiter.Burst()
+	if burst <= 0 {
+		burst = len(p)
+	}
+	written := 0
+	for written < len(p) {
+		end := written + burst
+		if end > len(p) {
+			end = len(p)
+		}
+		if err := w.limiter.WaitN(w.ctx, end-written); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func checksumCacheGet(key checksumCacheKey) (string, bool) {
+	checksumCacheMu.Lock()
+	defer checksumCacheMu.Unlock()
+	if el, ok := checksumCacheMap[key]; ok {
+		checksumCacheList.MoveToFront(el)
+		return el.Value.(checksumCacheKey2digest).digest, true
+	}
+	return "", false
+}
+
+func checksumCachePut(key checksumCacheKey, digest string) {
+	checksumCacheMu.Lock()
+	defer checksumCacheMu.Unlock()
+	if el, ok := checksumCacheMap[key]; ok {
+		checksumCacheList.MoveToFront(el)
+		return
+	}
+	el := checksumCacheList.PushFront(checksumCacheKey2digest{key: key, digest: digest})
+	checksumCacheMap[key] = el
+	if checksumCacheList.Len() > checksumCacheCapacity {
+		oldest := checksumCacheList.Back()
+		if oldest != nil {
+			checksumCacheList.Remove(oldest)
+			delete(checksumCacheMap, oldest.Value.(checksumCacheKey2digest).key)
+		}
+	}
+}
+
+// checksumCacheKey2digest 是 LRU 链表节点存储的值
+type checksumCacheKey2digest struct {
+	key    checksumCacheKey
+	digest string
+}
+
+// computeFileChecksum 计算文件的摘要，命中 LRU 缓存时跳过重新读取文件
+func computeFileChecksum(fullPath, algo string) (string, int64, error) {
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	key := checksumCacheKey{Path: fullPath, Algo: algo, MTime: info.ModTime().UnixNano(), Size: info.Size()}
+	if digest, ok := checksumCacheGet(key); ok {
+		return digest, info.Size(), nil
+	}
+
+	var h hash.Hash
+	switch algo {
+	case "md5":
+		h = md5.New()
+	case "sha256", "":
+		h = sha256.New()
+	default:
+		return "", 0, fmt.Errorf("不支持的校验算法: %s", algo)
+	}
+
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", 0, err
+	}
+
+	digest := hex.EncodeToString(h.Sum(nil))
+	checksumCachePut(key, digest)
+	return digest, info.Size(), nil
+}
+
+// streamTarArchive 将 fullPath 目录下的文件打包为 tar（可选 gzip 压缩）并直接写入 w，不落地临时文件
+func streamTarArchive(w io.Writer, absPath, fullPath string, gzipCompress bool) error {
+	var tw *tar.Writer
+	if gzipCompress {
+		gw := gzip.NewWriter(w)
+		defer gw.Close()
+		tw = tar.NewWriter(gw)
+	} else {
+		tw = tar.NewWriter(w)
+	}
+	defer tw.Close()
+
+	return filepath.Walk(fullPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(absPath, path)
+		if err != nil {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// streamZipArchive 将 fullPath 目录下的文件打包为 zip 并直接写入 w，不落地临时文件
+func streamZipArchive(w io.Writer, absPath, fullPath string) error {
+	zw := zip.NewWriter(w)
+	defer zw.Close()
+
+	return filepath.Walk(fullPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(absPath, path)
+		if err != nil {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		header.Method = zip.Deflate
+
+		entryWriter, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(entryWriter, f)
+		return err
+	})
+}
+
+// defaultUploadChunkSize 是客户端未指定 chunk_size 时使用的默认分片大小
+const defaultUploadChunkSize int64 = 4 * 1024 * 1024
+
+// uploadSession 跟踪一次分片续传上传的目标路径、期望大小/校验和以及落地的稀疏临时文件
+type uploadSession struct {
+	mu        sync.Mutex
+	path      string
+	size      int64
+	sha256    string
+	chunkSize int64
+	tempFile  *os.File
+}
+
+var (
+	uploadSessionsMu sync.Mutex
+	uploadSessions   = make(map[string]*uploadSession)
+)
+
+// generateUploadID 生成一个随机的上传会话 ID
+func generateUploadID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// writeChunkAt 将请求体中的字节流写入临时文件的指定偏移处，返回实际写入的字节数
+func writeChunkAt(f *os.File, r io.Reader, offset int64) (int64, error) {
+	buf := make([]byte, chunkBufSize)
+	written := int64(0)
+	cur := offset
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			if _, err := f.WriteAt(buf[:n], cur); err != nil {
+				return written, err
+			}
+			cur += int64(n)
+			written += int64(n)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return written, readErr
+		}
+	}
+	return written, nil
+}
+
+// progressLogInterval 是 --no-progress 模式下打印进度日志的间隔
+const progressLogInterval = 2 * time.Second
+
+// activeDirReporter 在 downloadDirectory 运行期间指向聚合进度条，
+// 使同一目录下所有并发下载的文件共用一条进度条而不是各显示各的
+var activeDirReporter *progressReporter
+
+// progressReporter 封装了 pb.ProgressBar，在 --no-progress 模式下退化为周期性日志输出
+type progressReporter struct {
+	bar    *pb.ProgressBar
+	ticker *time.Ticker
+	done   chan struct{}
+	total  int64
+	label  string
+	bytes  int64
+}
+
+// newProgressReporter 根据 --silent/--no-progress 选择图形进度条或周期性日志；
+// --silent 时返回 nil，所有方法都对 nil 接收者安全
+func newProgressReporter(label string, total int64) *progressReporter {
+	if silentMode {
+		return nil
+	}
+
+	if noProgress {
+		pr := &progressReporter{label: label, total: total, done: make(chan struct{})}
+		pr.ticker = time.NewTicker(progressLogInterval)
+		go pr.logLoop()
+		return pr
+	}
+
+	bar := pb.New64(total)
+	bar.Set("prefix", label+" ")
+	bar.Start()
+	return &progressReporter{bar: bar, label: label, total: total}
+}
+
+func (pr *progressReporter) logLoop() {
+	for {
+		select {
+		case <-pr.ticker.C:
+			bytes := atomic.LoadInt64(&pr.bytes)
+			if pr.total > 0 {
+				fmt.Printf("%s: %.1f%% (%.2f/%.2f MB)\n", pr.label,
+					float64(bytes)/float64(pr.total)*100, float64(bytes)/1024/1024, float64(pr.total)/1024/1024)
+			} else {
+				fmt.Printf("%s: 已传输 %.2f MB\n", pr.label, float64(bytes)/1024/1024)
+			}
+		case <-pr.done:
+			return
+		}
+	}
+}
+
+// Add 累加已传输的字节数，驱动图形进度条或周期性日志的计数器
+func (pr *progressReporter) Add(n int) {
+	if pr == nil {
+		return
+	}
+	if pr.bar != nil {
+		pr.bar.Add(n)
+		return
+	}
+	atomic.AddInt64(&pr.bytes, int64(n))
+}
+
+func (pr *progressReporter) Finish() {
+	if pr == nil {
+		return
+	}
+	if pr.bar != nil {
+		pr.bar.Finish()
+		return
+	}
+	pr.ticker.Stop()
+	close(pr.done)
+}
+
+// progressWriter 实现 io.Writer，用于包在 io.TeeReader 里统计已读取的字节数并驱动进度展示
+type progressWriter struct {
+	reporter *progressReporter
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	if limiter := rateLimiter(); limiter != nil {
+		if err := waitRateLimit(context.Background(), limiter, len(p)); err != nil {
+			return 0, err
+		}
+	}
+	w.reporter.Add(len(p))
+	return len(p), nil
+}
+
+// 客户端函数
+func loadDownloadState() DownloadState {
+	state := DownloadState{
+		Files:    make(map[string][]ChunkState),
+		Verified: make(map[string]string),
+	}
+	data, err := os.ReadFile(resumeFile)
+	if err == nil {
+		json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+func saveDownloadState(state DownloadState) {
+	data, err := json.Marshal(state)
+	if err == nil {
+		os.WriteFile(resumeFile, data, 0644)
+	}
+}
+
+// downloadStateMu 序列化对 resumeFile 的整个读-改-写过程。downloaddir 并发下载多个文件时，
+// 每个文件的 goroutine 都只在内存里持有自己那份 DownloadState 快照；若各自直接把快照整体写回
+// 磁盘，会用快照里其它文件的过期进度覆盖掉它们刚并发持久化的最新结果。因此任何一次落盘都必须
+// 在这把全局锁下重新读盘、只合并自己这一个文件（或校验记录）的条目，再整体写回
+var downloadStateMu sync.Mutex
+
+// persistDownloadChunks 在全局锁下重新读取 resume 文件，只合并 filePath 对应的分片进度后保存，
+// 避免并发下载的多个文件相互覆盖彼此的进度
+func persistDownloadChunks(filePath string, chunks []ChunkState) {
+	downloadStateMu.Lock()
+	defer downloadStateMu.Unlock()
+	state := loadDownloadState()
+	state.Files[filePath] = chunks
+	saveDownloadState(state)
+}
+
+// persistVerifiedDigest 在全局锁下重新读取 resume 文件，只合并 filePath 对应的校验记录后保存
+func persistVerifiedDigest(filePath, algo, digest string) {
+	downloadStateMu.Lock()
+	defer downloadStateMu.Unlock()
+	state := loadDownloadState()
+	state.Verified[filePath] = algo + ":" + digest
+	saveDownloadState(state)
+}
+
+// newRequest 构造一个 HTTP 请求，设置了 --token 时自动携带 Authorization: Bearer 请求头
+func newRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+	return req, nil
+}
+
+var (
+	clientLimiter     *rate.Limiter
+	clientLimiterOnce sync.Once
+)
+
+// rateLimiter 按 --rate-limit 惰性构造客户端限速器，未设置限速时返回 nil
+func rateLimiter() *rate.Limiter {
+	clientLimiterOnce.Do(func() {
+		if rateLimitBytes > 0 {
+			clientLimiter = rate.NewLimiter(rate.Limit(rateLimitBytes), int(rateLimitBytes))
+		}
+	})
+	return clientLimiter
+}
+
+// maxRetry429 是遇到服务器 429 限流响应时的最大重试次数
+const maxRetry429 = 5
+
+// doWithRetry429 执行请求，若响应为 429 则按 Retry-After（缺省时指数退避）等待后重试；
+// buildReq 在每次尝试时重新构造请求，以便携带未消费过的请求体
+func doWithRetry429(client *http.Client, buildReq func() (*http.Request, error)) (*http.Response, error) {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		req, err := buildReq()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= maxRetry429 {
+			return resp, nil
+		}
+
+		wait := backoff
+		if ra := resp.Header.Get("Retry-After"); ra != "" {
+			if secs, err := strconv.Atoi(ra); err == nil {
+				wait = time.Duration(secs) * time.Second
+			}
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		fmt.Printf("服务器限流（429），%v 后重试（第 %d 次）\n", wait, attempt+1)
+		time.Sleep(wait)
+		backoff *= 2
+	}
+}
+
+// probeRange 通过 Range: bytes=0-0 探测文件总大小以及服务器是否支持分片下载
+func probeRange(filePath string) (int64, bool, error) {
+	encodedPath := url.PathEscape(filePath)
+	reqURL := fmt.Sprintf("%s/download/%s", serverURL, encodedPath)
+
+	client := &http.Client{}
+	resp, err := doWithRetry429(client, func() (*http.Request, error) {
+		req, err := newRequest("GET", reqURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Range", "bytes=0-0")
+		return req, nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode == http.StatusPartialContent {
+		if size, ok := parseContentRangeSize(resp.Header.Get("Content-Range")); ok {
+			return size, true, nil
+		}
+	}
+
+	return resp.ContentLength, false, nil
+}
+
+// parseContentRangeSize 从形如 "bytes 0-0/12345" 的 Content-Range 中提取总大小
+func parseContentRangeSize(contentRange string) (int64, bool) {
+	idx := strings.LastIndex(contentRange, "/")
+	if idx == -1 || idx == len(contentRange)-1 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(contentRange[idx+1:], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+// buildChunks 按并发数将 [0, totalSize) 切分成若干分片
+func buildChunks(totalSize int64, n int) []ChunkState {
+	if n < 1 {
+		n = 1
+	}
+	chunkSize := totalSize / int64(n)
+	if chunkSize < 1 {
+		chunkSize = totalSize
+		n = 1
+	}
+
+	chunks := make([]ChunkState, 0, n)
+	from := int64(0)
+	for i := 0; i < n && from < totalSize; i++ {
+		to := from + chunkSize - 1
+		if i == n-1 || to >= totalSize-1 {
+			to = totalSize - 1
+		}
+		chunks = append(chunks, ChunkState{From: from, To: to})
+		from = to + 1
+	}
+	return chunks
+}
+
+// chunksComplete 判断某个文件的全部分片是否都已下载完成
+func chunksComplete(chunks []ChunkState) bool {
+	for _, chunk := range chunks {
+		if chunk.Downloaded < chunk.To-chunk.From+1 {
+			return false
+		}
+	}
+	return true
+}
+
+func downloadFile(filePath string) {
+	if verifyAlgo != "" && alreadyVerified(filePath) {
+		fmt.Printf("文件 %s 已验证且未变化，跳过下载\n", filePath)
+		// 即使跳过下载，也要把这个文件的大小计入聚合进度条，否则 downloaddir 的整体
+		// 百分比会因为被跳过的文件而永远到不了 100%
+		if info, err := os.Stat(filepath.Join(savePath, filePath)); err == nil {
+			activeDirReporter.Add(int(info.Size()))
+		}
+		return
+	}
+
+	totalSize, acceptRanges, err := probeRange(filePath)
+	if err != nil {
+		fmt.Printf("探测文件信息失败: %v\n", err)
+		return
+	}
+
+	saveDir := filepath.Join(savePath, filepath.Dir(filePath))
+	if err := os.MkdirAll(saveDir, 0755); err != nil {
+		fmt.Printf("创建目录失败: %v\n", err)
+		return
+	}
+	fileName := filepath.Join(savePath, filePath)
+
+	if !acceptRanges || totalSize <= 0 {
+		downloadFileWhole(filePath, fileName, totalSize)
+		return
+	}
+
+	downloadStateMu.Lock()
+	chunks, resuming := loadDownloadState().Files[filePath]
+	downloadStateMu.Unlock()
+	if !resuming || int64(len(chunks)) == 0 {
+		chunks = buildChunks(totalSize, concurrency)
+	} else if chunksComplete(chunks) {
+		if info, err := os.Stat(fileName); err == nil && info.Size() == totalSize {
+			fmt.Printf("文件 %s 已存在且完整，跳过下载\n", filePath)
+			activeDirReporter.Add(int(totalSize))
+			return
+		}
+		chunks = buildChunks(totalSize, concurrency)
+	}
+
+	fmt.Printf("开始下载: %s (大小: %.2f MB, %d 个分片)\n", filePath, float64(totalSize)/1024/1024, len(chunks))
+
+	out, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Printf("创建文件失败: %v\n", err)
+		return
+	}
+	defer out.Close()
+
+	reporter := activeDirReporter
+	if reporter == nil {
+		reporter = newProgressReporter(filePath, totalSize)
+		defer reporter.Finish()
+	}
+
+	// 断点续传时这些字节不会再经过 progressWriter，需要补种到进度条，否则恢复下载的
+	// 文件永远显示不到 100%
+	var alreadyDownloaded int64
+	for _, chunk := range chunks {
+		alreadyDownloaded += chunk.Downloaded
+	}
+	if alreadyDownloaded > 0 {
+		reporter.Add(int(alreadyDownloaded))
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(chunks))
+
+	for i := range chunks {
+		if chunks[i].Downloaded >= chunks[i].To-chunks[i].From+1 {
+			continue // 该分片已完成，跳过
+		}
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			if err := downloadChunk(filePath, out, &chunks[idx], &mu, chunks, reporter); err != nil {
+				errCh <- err
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errCh)
+
+	persistDownloadChunks(filePath, chunks)
+
+	for err := range errCh {
+		fmt.Printf("下载分片失败: %v\n", err)
+		return
+	}
+
+	fmt.Printf("成功下载: %s (%.2f MB)\n", fileName, float64(totalSize)/1024/1024)
+}
+
+// downloadChunk 下载 chunk 中尚未完成的字节范围，并通过 WriteAt 写入目标文件的对应偏移。
+// chunks 是该文件全部分片的共享切片（chunk 是其中一个元素），落盘时整体传给
+// persistDownloadChunks，以便只合并这一个文件的进度
+func downloadChunk(filePath string, out *os.File, chunk *ChunkState, mu *sync.Mutex, chunks []ChunkState, reporter *progressReporter) error {
+	from := chunk.From + chunk.Downloaded
+	if from > chunk.To {
+		return nil
+	}
+
+	encodedPath := url.PathEscape(filePath)
+	reqURL := fmt.Sprintf("%s/download/%s", serverURL, encodedPath)
+
+	client := &http.Client{}
+	resp, err := doWithRetry429(client, func() (*http.Request, error) {
+		req, err := newRequest("GET", reqURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, chunk.To))
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("服务器返回错误状态码: %d", resp.StatusCode)
+	}
+
+	teeReader := io.TeeReader(resp.Body, &progressWriter{reporter: reporter})
+
+	buf := make([]byte, chunkBufSize)
+	offset := from
+	lastSave := time.Now()
+	for {
+		n, readErr := teeReader.Read(buf)
+		if n > 0 {
+			if _, err := out.WriteAt(buf[:n], offset); err != nil {
+				return err
+			}
+			offset += int64(n)
+
+			mu.Lock()
+			chunk.Downloaded = offset - chunk.From
+			// 落盘节流：避免每次 32KB Read 都同步全量序列化并重写 resume 文件，
+			// 那样会让并发分片在共享锁上排队，退化成串行下载
+			if time.Since(lastSave) >= stateSaveInterval {
+				persistDownloadChunks(filePath, chunks)
+				lastSave = time.Now()
+			}
+			mu.Unlock()
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	// 分片下载完成时无条件落盘一次，确保断点续传不会丢失刚完成的分片
+	mu.Lock()
+	persistDownloadChunks(filePath, chunks)
+	mu.Unlock()
+
+	return nil
+}
+
+// downloadFileWhole 是服务器不支持 Range 请求时的回退路径，整文件单次下载
+func downloadFileWhole(filePath, fileName string, totalSize int64) {
+	encodedPath := url.PathEscape(filePath)
+	reqURL := fmt.Sprintf("%s/download/%s", serverURL, encodedPath)
+
+	client := &http.Client{}
+	resp, err := doWithRetry429(client, func() (*http.Request, error) {
+		return newRequest("GET", reqURL, nil)
+	})
+	if err != nil {
+		fmt.Printf("获取文件失败: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("服务器返回错误状态码: %d\n", resp.StatusCode)
+		return
+	}
+
+	if totalSize > 0 {
+		fmt.Printf("开始下载: %s (大小: %.2f MB)\n", filePath, float64(totalSize)/1024/1024)
+	} else {
+		fmt.Printf("警告: 无法获取文件 %s 的大小，将继续下载\n", filePath)
+	}
+
+	if info, err := os.Stat(fileName); err == nil {
+		if totalSize > 0 && info.Size() == totalSize {
+			fmt.Printf("文件 %s 已存在且完整，跳过下载\n", filePath)
+			activeDirReporter.Add(int(totalSize))
+			return
+		}
+	}
+
+	out, err := os.Create(fileName)
+	if err != nil {
+		fmt.Printf("创建文件失败: %v\n", err)
+		return
+	}
+	defer out.Close()
+
+	reporter := activeDirReporter
+	if reporter == nil {
+		reporter = newProgressReporter(filePath, totalSize)
+		defer reporter.Finish()
+	}
+	teeReader := io.TeeReader(resp.Body, &progressWriter{reporter: reporter})
+
+	written, err := io.Copy(out, teeReader)
+	if err != nil {
+		fmt.Printf("保存文件失败: %v\n", err)
+		return
+	}
+
+	if totalSize > 0 && written != totalSize {
+		fmt.Printf("警告: 文件大小不匹配，预期 %.2f MB，实际 %.2f MB\n",
+			float64(totalSize)/1024/1024,
+			float64(written)/1024/1024)
+		return
+	}
+
+	fmt.Printf("成功下载: %s (%.2f MB)\n", fileName, float64(written)/1024/1024)
+}
+
+// newHasher 根据算法名创建对应的哈希实例，默认使用 sha256
+func newHasher(algo string) (hash.Hash, error) {
+	switch algo {
+	case "md5":
+		return md5.New(), nil
+	case "sha256", "":
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("不支持的校验算法: %s", algo)
+	}
+}
+
+// fetchServerChecksum 调用 /checksum 接口获取服务器上文件的摘要
+func fetchServerChecksum(filePath, algo string) (string, error) {
+	encodedPath := url.PathEscape(filePath)
+	reqURL := fmt.Sprintf("%s/checksum/%s?algo=%s", serverURL, encodedPath, algo)
+
+	client := &http.Client{}
+	resp, err := doWithRetry429(client, func() (*http.Request, error) {
+		return newRequest("GET", reqURL, nil)
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("服务器返回错误状态码: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Hex string `json:"hex"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result.Hex, nil
+}
+
+// localFileChecksum 对本地文件内容计算摘要
+func localFileChecksum(fileName, algo string) (string, error) {
+	h, err := newHasher(algo)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// alreadyVerified 检查本地文件是否已经验证过且摘要仍然匹配，用于跳过重复下载
+func alreadyVerified(filePath string) bool {
+	downloadStateMu.Lock()
+	recorded, ok := loadDownloadState().Verified[filePath]
+	downloadStateMu.Unlock()
+	if !ok {
+		return false
+	}
+	prefix := verifyAlgo + ":"
+	if !strings.HasPrefix(recorded, prefix) {
+		return false
+	}
+
+	fileName := filepath.Join(savePath, filePath)
+	localHex, err := localFileChecksum(fileName, verifyAlgo)
+	if err != nil {
+		return false
+	}
+	return localHex == strings.TrimPrefix(recorded, prefix)
+}
+
+// markVerified 将校验通过的摘要写入断点续传状态文件
+func markVerified(filePath, algo, digest string) {
+	persistVerifiedDigest(filePath, algo, digest)
+}
+
+// verifyAndRetry 在下载完成后校验文件完整性，失败时删除并重试，最多 maxVerifyRetries 次
+func verifyAndRetry(filePath string) {
+	if verifyAlgo == "" {
+		return
+	}
+
+	fileName := filepath.Join(savePath, filePath)
+
+	for attempt := 0; ; attempt++ {
+		serverHex, err := fetchServerChecksum(filePath, verifyAlgo)
+		if err != nil {
+			fmt.Printf("获取服务器校验和失败: %v\n", err)
+			return
+		}
+
+		localHex, err := localFileChecksum(fileName, verifyAlgo)
+		if err != nil {
+			fmt.Printf("计算本地校验和失败: %v\n", err)
+			return
+		}
+
+		if localHex == serverHex {
+			fmt.Printf("校验通过: %s (%s)\n", filePath, verifyAlgo)
+			markVerified(filePath, verifyAlgo, localHex)
+			return
+		}
+
+		if attempt >= maxVerifyRetries {
+			fmt.Printf("校验失败次数过多，放弃: %s\n", filePath)
+			return
+		}
+
+		fmt.Printf("校验失败: %s (本地 %s, 服务器 %s)，重新下载第 %d 次\n", filePath, localHex, serverHex, attempt+1)
+		os.Remove(fileName)
+		downloadFile(filePath)
+	}
+}
+
+func downloadDirectory(dirPath string) {
+	encodedPath := url.PathEscape(dirPath)
+	reqURL := fmt.Sprintf("%s/list/%s", serverURL, encodedPath)
+
+	client := &http.Client{}
+	resp, err := doWithRetry429(client, func() (*http.Request, error) {
+		return newRequest("GET", reqURL, nil)
+	})
+	if err != nil {
+		fmt.Printf("获取目录列表失败: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("错误: 服务器返回状态码 %d\n", resp.StatusCode)
+		return
+	}
+
+	var result struct {
+		Files []FileInfo `json:"files"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		fmt.Printf("解析响应失败: %v\n", err)
+		return
+	}
+
+	if len(result.Files) == 0 {
+		fmt.Printf("目录 %s 为空或不存在\n", dirPath)
+		return
+	}
+
+	var totalSize int64
+	for _, file := range result.Files {
+		totalSize += file.Size
+	}
+	activeDirReporter = newProgressReporter(fmt.Sprintf("下载目录 %s", dirPath), totalSize)
+
+	tasks := make(chan FileInfo, len(result.Files))
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range tasks {
+				downloadFile(file.Path)
+				verifyAndRetry(file.Path)
+			}
+		}()
+	}
+
+	for _, file := range result.Files {
+		tasks <- file
+	}
+	close(tasks)
+
+	wg.Wait()
+	activeDirReporter.Finish()
+	activeDirReporter = nil
+	fmt.Printf("目录下载完成: %s\n", dirPath)
+}
+
+func listServerContent(dirPath string) {
+	encodedPath := url.PathEscape(dirPath)
+	reqURL := fmt.Sprintf("%s/list/%s", serverURL, encodedPath)
+
+	client := &http.Client{}
+	resp, err := doWithRetry429(client, func() (*http.Request, error) {
+		return newRequest("GET", reqURL, nil)
+	})
+	if err != nil {
+		fmt.Printf("获取目录列表失败: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("错误: 服务器返回状态码 %d\n", resp.StatusCode)
+		return
+	}
+
+	var result struct {
+		Files []FileInfo `json:"files"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		fmt.Printf("解析响应失败: %v\n", err)
+		return
+	}
+
+	dirs := make(map[string]bool)
+	for _, file := range result.Files {
+		dir := filepath.Dir(file.Path)
+		if dir != "." {
+			dirs[dir] = true
+		}
+	}
+
+	fmt.Println("可用的目录:")
+	for dir := range dirs {
+		fmt.Printf("- %s\n", dir)
+	}
+}
+
+// downloadArchive 从 /archive 接口拉取目录归档，按 --extract 决定保存原文件还是直接解包
+func downloadArchive(dirPath string) {
+	encodedPath := url.PathEscape(dirPath)
+	reqURL := fmt.Sprintf("%s/archive/%s?format=%s", serverURL, encodedPath, url.QueryEscape(archiveFormat))
+
+	client := &http.Client{}
+	resp, err := doWithRetry429(client, func() (*http.Request, error) {
+		return newRequest("GET", reqURL, nil)
+	})
+	if err != nil {
+		fmt.Printf("获取归档失败: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("服务器返回错误状态码: %d\n", resp.StatusCode)
+		return
+	}
+
+	if err := os.MkdirAll(savePath, 0755); err != nil {
+		fmt.Printf("创建目录失败: %v\n", err)
+		return
+	}
+
+	if archiveExtract {
+		if err := extractArchive(resp.Body, archiveFormat, savePath); err != nil {
+			fmt.Printf("解包归档失败: %v\n", err)
+			return
+		}
+		fmt.Printf("归档已解包到: %s\n", savePath)
+		return
+	}
+
+	outPath := filepath.Join(savePath, filepath.Base(dirPath)+"."+archiveFormat)
+	out, err := os.Create(outPath)
+	if err != nil {
+		fmt.Printf("创建文件失败: %v\n", err)
+		return
+	}
+	defer out.Close()
+
+	written, err := io.Copy(out, resp.Body)
+	if err != nil {
+		fmt.Printf("保存归档失败: %v\n", err)
+		return
+	}
+
+	fmt.Printf("成功下载归档: %s (%.2f MB)\n", outPath, float64(written)/1024/1024)
+}
+
+// extractArchive 按格式选择对应的解包方式；zip 需要随机访问，因此先落地到临时文件
+func extractArchive(r io.Reader, format, outputDir string) error {
+	switch format {
+	case "zip":
+		return extractZipArchive(r, outputDir)
+	case "tar":
+		return extractTarArchive(r, outputDir)
+	case "tar.gz", "":
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		return extractTarArchive(gr, outputDir)
+	default:
+		return fmt.Errorf("不支持的归档格式: %s", format)
+	}
+}
+
+func extractTarArchive(r io.Reader, outputDir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := safeJoin(outputDir, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			out.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func extractZipArchive(r io.Reader, outputDir string) error {
+	tmp, err := os.CreateTemp("", "fileshare-archive-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		return err
+	}
+
+	zr, err := zip.OpenReader(tmp.Name())
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		target, err := safeJoin(outputDir, f.Name)
+		if err != nil {
+			return err
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.Mode())
+		if err != nil {
+			rc.Close()
+			return err
+		}
+
+		_, err = io.Copy(out, rc)
+		rc.Close()
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// safeJoin 将归档条目名解析到 outputDir 下，拒绝逃逸到目标目录之外的路径（zip slip 防护）
+func safeJoin(outputDir, name string) (string, error) {
+	target := filepath.Join(outputDir, name)
+	base := filepath.Clean(outputDir)
+	if target != base && !strings.HasPrefix(target, base+string(os.PathSeparator)) {
+		return "", fmt.Errorf("非法的归档路径: %s", name)
+	}
+	return target, nil
+}
+
+func loadUploadState() UploadState {
+	state := UploadState{
+		Files: make(map[string]UploadFileState),
+	}
+	data, err := os.ReadFile(uploadResumeFile)
+	if err == nil {
+		json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+func saveUploadState(state UploadState) {
+	data, err := json.Marshal(state)
+	if err == nil {
+		os.WriteFile(uploadResumeFile, data, 0644)
+	}
+}
+
+// initUpload 向服务器申请一个分片续传上传会话
+func initUpload(remotePath string, size int64, sha256Hex string) (string, int64, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"path":       remotePath,
+		"size":       size,
+		"sha256":     sha256Hex,
+		"chunk_size": defaultUploadChunkSize,
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	client := &http.Client{}
+	resp, err := doWithRetry429(client, func() (*http.Request, error) {
+		req, err := newRequest("POST", fmt.Sprintf("%s/upload/init", serverURL), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("初始化上传失败，状态码: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		UploadID  string `json:"upload_id"`
+		ChunkSize int64  `json:"chunk_size"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", 0, err
+	}
+	return result.UploadID, result.ChunkSize, nil
+}
+
+// uploadChunk 读取本地文件中对应分片的字节范围并通过 PUT 上传
+func uploadChunk(f *os.File, uploadID string, chunkSize, fileSize int64, index int) error {
+	offset := int64(index) * chunkSize
+	size := chunkSize
+	if remaining := fileSize - offset; remaining < size {
+		size = remaining
+	}
+	if size < 0 {
+		size = 0
+	}
+
+	buf := make([]byte, size)
+	if size > 0 {
+		if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+			return err
+		}
+	}
+
+	reqURL := fmt.Sprintf("%s/upload/chunk/%s?index=%d", serverURL, uploadID, index)
+	client := &http.Client{}
+	resp, err := doWithRetry429(client, func() (*http.Request, error) {
+		return newRequest("PUT", reqURL, bytes.NewReader(buf))
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errUploadSessionExpired
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("上传分片 %d 失败，状态码: %d", index, resp.StatusCode)
+	}
+	return nil
+}
+
+// completeUpload 通知服务器校验并落地已上传的分片
+func completeUpload(uploadID string) error {
+	client := &http.Client{}
+	resp, err := doWithRetry429(client, func() (*http.Request, error) {
+		return newRequest("POST", fmt.Sprintf("%s/upload/complete/%s", serverURL, uploadID), nil)
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("完成上传失败，状态码: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// uploadFile 以分片续传协议上传单个本地文件，中断后可根据 uploadResumeFile 中的进度继续
+func uploadFile(localPath, remotePath string) error {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s 是一个目录，请使用 uploaddir", localPath)
+	}
+
+	digest, err := localFileChecksum(localPath, "sha256")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	state := loadUploadState()
+	fileState, resuming := state.Files[remotePath]
+	needInit := !resuming || fileState.SHA256 != digest || fileState.Size != info.Size()
+
+	for attempt := 0; ; attempt++ {
+		if needInit {
+			uploadID, chunkSize, err := initUpload(remotePath, info.Size(), digest)
+			if err != nil {
+				return err
+			}
+			fileState = UploadFileState{
+				UploadID:  uploadID,
+				ChunkSize: chunkSize,
+				Size:      info.Size(),
+				SHA256:    digest,
+				Chunks:    make(map[int]bool),
+			}
+		} else {
+			fmt.Printf("继续上传: %s (上传 ID: %s)\n", remotePath, fileState.UploadID)
+		}
+		state.Files[remotePath] = fileState
+		saveUploadState(state)
+
+		totalChunks := 1
+		if fileState.Size > 0 {
+			totalChunks = int((fileState.Size + fileState.ChunkSize - 1) / fileState.ChunkSize)
+		}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		tasks := make(chan int, totalChunks)
+		errCh := make(chan error, totalChunks)
+
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for index := range tasks {
+					mu.Lock()
+					done := fileState.Chunks[index]
+					mu.Unlock()
+					if done {
+						continue
+					}
+					if err := uploadChunk(f, fileState.UploadID, fileState.ChunkSize, fileState.Size, index); err != nil {
+						errCh <- err
+						continue
+					}
+
+					mu.Lock()
+					fileState.Chunks[index] = true
+					state.Files[remotePath] = fileState
+					saveUploadState(state)
+					mu.Unlock()
+				}
+			}()
+		}
+
+		for i := 0; i < totalChunks; i++ {
+			tasks <- i
+		}
+		close(tasks)
+		wg.Wait()
+		close(errCh)
+
+		sessionExpired := false
+		for err := range errCh {
+			if errors.Is(err, errUploadSessionExpired) {
+				sessionExpired = true
+				continue
+			}
+			return err
+		}
+
+		if sessionExpired {
+			if attempt >= maxUploadSessionRetries {
+				return fmt.Errorf("上传会话反复失效，已重试 %d 次: %s", attempt, remotePath)
+			}
+			fmt.Printf("上传会话已失效（服务器可能已重启），重新初始化后重试: %s\n", remotePath)
+			delete(state.Files, remotePath)
+			needInit = true
+			continue
+		}
+
+		if err := completeUpload(fileState.UploadID); err != nil {
+			return err
+		}
+
+		delete(state.Files, remotePath)
+		saveUploadState(state)
+
+		fmt.Printf("成功上传: %s -> %s (%.2f MB)\n", localPath, remotePath, float64(info.Size())/1024/1024)
+		return nil
+	}
+}
+
+// uploadDirectory 递归遍历本地目录并以 --concurrency 个 worker 并行上传每个文件
+func uploadDirectory(localDir, remoteDir string) {
+	type uploadTask struct {
+		local  string
+		remote string
+	}
+
+	var tasks []uploadTask
+	err := filepath.Walk(localDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(localDir, path)
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, uploadTask{local: path, remote: filepath.ToSlash(filepath.Join(remoteDir, rel))})
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("遍历本地目录失败: %v\n", err)
+		return
+	}
+
+	if len(tasks) == 0 {
+		fmt.Printf("目录 %s 为空\n", localDir)
+		return
+	}
+
+	taskCh := make(chan uploadTask, len(tasks))
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range taskCh {
+				if err := uploadFile(t.local, t.remote); err != nil {
+					fmt.Printf("上传 %s 失败: %v\n", t.local, err)
+				}
+			}
+		}()
+	}
+
+	for _, t := range tasks {
+		taskCh <- t
+	}
+	close(taskCh)
+	wg.Wait()
+
+	fmt.Printf("目录上传完成: %s\n", localDir)
+}
+
+func loadSyncManifest() syncManifest {
+	manifest := syncManifest{Files: make(map[string]manifestEntry)}
+	data, err := os.ReadFile(manifestFile)
+	if err == nil {
+		json.Unmarshal(data, &manifest)
+	}
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]manifestEntry)
+	}
+	return manifest
+}
+
+func saveSyncManifest(manifest syncManifest) {
+	data, err := json.Marshal(manifest)
+	if err == nil {
+		os.WriteFile(manifestFile, data, 0644)
+	}
+}
+
+// fetchServerManifest 请求 /list 接口获取远程目录清单；若 prevETag 非空且服务器返回 304，
+// notModified 为 true，调用方应复用本地缓存的清单而无需重新下载文件列表
+func fetchServerManifest(dirPath, prevETag string) (files []FileInfo, etag string, notModified bool, err error) {
+	encodedPath := url.PathEscape(dirPath)
+	reqURL := fmt.Sprintf("%s/list/%s", serverURL, encodedPath)
+
+	client := &http.Client{}
+	resp, err := doWithRetry429(client, func() (*http.Request, error) {
+		req, err := newRequest("GET", reqURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		if prevETag != "" {
+			req.Header.Set("If-None-Match", prevETag)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, prevETag, true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", false, fmt.Errorf("服务器返回错误状态码: %d", resp.StatusCode)
+	}
 
 	var result struct {
 		Files []FileInfo `json:"files"`
 	}
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, "", false, err
+	}
+
+	return result.Files, resp.Header.Get("ETag"), false, nil
+}
+
+// scanLocalFiles 递归扫描本地目录，返回 相对路径（斜杠分隔） -> 文件信息 的映射
+func scanLocalFiles(localDir string) (map[string]os.FileInfo, error) {
+	files := make(map[string]os.FileInfo)
+	err := filepath.Walk(localDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(localDir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = info
+		return nil
+	})
+	return files, err
+}
+
+// diffSyncManifest 比较服务器清单与本地扫描结果，返回需要下载（新增或内容变化）
+// 和需要删除（仅当 delete 为 true 时，本地存在但清单中已不存在）的相对路径列表，两者均按路径排序
+func diffSyncManifest(manifestFiles map[string]manifestEntry, localFiles map[string]os.FileInfo, delete bool) (toDownload, toDelete []string) {
+	for path, entry := range manifestFiles {
+		info, exists := localFiles[path]
+		if !exists || info.Size() != entry.Size || info.ModTime().Unix() != entry.MTime {
+			toDownload = append(toDownload, path)
+		}
+	}
+
+	if delete {
+		for path := range localFiles {
+			if _, ok := manifestFiles[path]; !ok {
+				toDelete = append(toDelete, path)
+			}
+		}
+	}
+
+	sort.Strings(toDownload)
+	sort.Strings(toDelete)
+	return toDownload, toDelete
+}
+
+// pathRelativeToRemoteDir 将 /list 返回的、相对于服务器 --path 根目录的路径
+// 转换为相对于本次 sync 所请求的 remoteDir 的路径，使其能与 scanLocalFiles 的结果比对
+func pathRelativeToRemoteDir(serverPath, remoteDir string) string {
+	remoteDir = filepath.Clean(filepath.FromSlash(remoteDir))
+	if remoteDir == "." || remoteDir == "" {
+		return filepath.ToSlash(filepath.Clean(serverPath))
+	}
+	rel, err := filepath.Rel(remoteDir, filepath.FromSlash(serverPath))
 	if err != nil {
-		fmt.Printf("解析响应失败: %v\n", err)
+		return filepath.ToSlash(filepath.Clean(serverPath))
+	}
+	return filepath.ToSlash(rel)
+}
+
+// syncDownloadFile 直接将服务器上的单个文件下载到 localPath，不经过 savePath/DownloadState，
+// 因为 sync 的本地落盘位置（相对于 localDir）和 serverPath（相对于服务器根目录）可能并不一致
+func syncDownloadFile(serverPath, localPath string) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+
+	encodedPath := url.PathEscape(serverPath)
+	reqURL := fmt.Sprintf("%s/download/%s", serverURL, encodedPath)
+
+	client := &http.Client{}
+	resp, err := doWithRetry429(client, func() (*http.Request, error) {
+		return newRequest("GET", reqURL, nil)
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("服务器返回错误状态码: %d", resp.StatusCode)
+	}
+
+	out, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
+
+// syncDirectory 将远程目录 remoteDir 的内容镜像到本地目录 localDir：新增或内容有变化的文件会被下载，
+// --delete 时本地多出的文件会被删除，--dry-run 时只打印计划执行的操作
+func syncDirectory(remoteDir, localDir string) {
+	manifest := loadSyncManifest()
+
+	serverFiles, etag, notModified, err := fetchServerManifest(remoteDir, manifest.ETag)
+	if err != nil {
+		fmt.Printf("获取远程清单失败: %v\n", err)
 		return
 	}
 
-	dirs := make(map[string]bool)
-	for _, file := range result.Files {
-		dir := filepath.Dir(file.Path)
-		if dir != "." {
-			dirs[dir] = true
+	if notModified {
+		fmt.Println("远程目录未发生变化（304），复用本地缓存的清单")
+	} else {
+		manifest.ETag = etag
+		manifest.Files = make(map[string]manifestEntry, len(serverFiles))
+		for _, f := range serverFiles {
+			relPath := pathRelativeToRemoteDir(f.Path, remoteDir)
+			manifest.Files[relPath] = manifestEntry{Path: relPath, ServerPath: f.Path, Size: f.Size, MTime: f.MTime}
 		}
 	}
 
-	fmt.Println("可用的目录:")
-	for dir := range dirs {
-		fmt.Printf("- %s\n", dir)
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		fmt.Printf("创建本地目录失败: %v\n", err)
+		return
+	}
+	localFiles, err := scanLocalFiles(localDir)
+	if err != nil {
+		fmt.Printf("扫描本地目录失败: %v\n", err)
+		return
+	}
+
+	toDownload, toDelete := diffSyncManifest(manifest.Files, localFiles, syncDelete)
+
+	if syncDryRun {
+		fmt.Printf("计划下载/更新 %d 个文件，删除 %d 个文件（--dry-run，不会实际执行）\n", len(toDownload), len(toDelete))
+		for _, path := range toDownload {
+			fmt.Printf("  + %s\n", path)
+		}
+		for _, path := range toDelete {
+			fmt.Printf("  - %s\n", path)
+		}
+		return
 	}
+
+	for _, path := range toDownload {
+		entry := manifest.Files[path]
+		localPath := filepath.Join(localDir, filepath.FromSlash(path))
+		if err := syncDownloadFile(entry.ServerPath, localPath); err != nil {
+			fmt.Printf("下载 %s 失败: %v\n", path, err)
+			continue
+		}
+		// 将本地文件的修改时间设为服务器端的 mtime，使下一次 diffSyncManifest 能识别出未变化的文件
+		mtime := time.Unix(entry.MTime, 0)
+		if err := os.Chtimes(localPath, mtime, mtime); err != nil {
+			fmt.Printf("设置 %s 的修改时间失败: %v\n", path, err)
+		}
+	}
+
+	for _, path := range toDelete {
+		if err := os.Remove(filepath.Join(localDir, path)); err != nil {
+			fmt.Printf("删除 %s 失败: %v\n", path, err)
+		}
+	}
+
+	saveSyncManifest(manifest)
+	fmt.Printf("同步完成: 新增/更新 %d 个文件，删除 %d 个文件\n", len(toDownload), len(toDelete))
 }
 
 func main() {
@@ -417,4 +2539,4 @@ func main() {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-} 
\ No newline at end of file
+}
\ No newline at end of file
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRenderMetricsReportsCountersAndLabeledRequests(t *testing.T) {
+	prevBytes := atomic.LoadInt64(&bytesServedTotal)
+	prevActive := atomic.LoadInt64(&activeTransfers)
+	requestCountMu.Lock()
+	prevCounts := requestCountPath
+	requestCountPath = make(map[string]int64)
+	requestCountMu.Unlock()
+	defer func() {
+		atomic.StoreInt64(&bytesServedTotal, prevBytes)
+		atomic.StoreInt64(&activeTransfers, prevActive)
+		requestCountMu.Lock()
+		requestCountPath = prevCounts
+		requestCountMu.Unlock()
+	}()
+
+	atomic.StoreInt64(&bytesServedTotal, 2048)
+	atomic.StoreInt64(&activeTransfers, 3)
+	requestCountMu.Lock()
+	requestCountPath["/download/*path"] = 5
+	requestCountMu.Unlock()
+
+	out := renderMetrics()
+
+	if !strings.Contains(out, "fileshare_bytes_served_total 2048") {
+		t.Errorf("expected bytes served total in output, got: %s", out)
+	}
+	if !strings.Contains(out, "fileshare_active_transfers 3") {
+		t.Errorf("expected active transfers in output, got: %s", out)
+	}
+	if !strings.Contains(out, `fileshare_requests_total{path="/download/*path"} 5`) {
+		t.Errorf("expected labeled request count in output, got: %s", out)
+	}
+}
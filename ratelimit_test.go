@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+func TestTokenRateLimiterSharesLimiterPerToken(t *testing.T) {
+	authLimitersMu.Lock()
+	authLimiters = make(map[string]*rate.Limiter)
+	authLimitersMu.Unlock()
+
+	entry := authEntry{RateBytesPerSec: 1024}
+
+	first := tokenRateLimiter("tok-a", entry)
+	second := tokenRateLimiter("tok-a", entry)
+	if first != second {
+		t.Fatal("expected repeated calls for the same token to return the same limiter")
+	}
+
+	other := tokenRateLimiter("tok-b", entry)
+	if other == first {
+		t.Fatal("expected a different token to get its own limiter")
+	}
+}
+
+func TestWaitRateLimitHandlesRequestsLargerThanBurst(t *testing.T) {
+	limiter := rate.NewLimiter(rate.Limit(1<<20), 16)
+
+	if err := waitRateLimit(context.Background(), limiter, 64); err != nil {
+		t.Fatalf("waitRateLimit should split n across burst-sized WaitN calls, got error: %v", err)
+	}
+}
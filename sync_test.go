@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPathRelativeToRemoteDir(t *testing.T) {
+	cases := []struct {
+		serverPath string
+		remoteDir  string
+		want       string
+	}{
+		{"photos/a.jpg", "photos", "a.jpg"},
+		{"photos/sub/b.jpg", "photos", "sub/b.jpg"},
+		{"a.txt", ".", "a.txt"},
+		{"dir/a.txt", "", "dir/a.txt"},
+	}
+
+	for _, c := range cases {
+		got := pathRelativeToRemoteDir(c.serverPath, c.remoteDir)
+		if got != c.want {
+			t.Errorf("pathRelativeToRemoteDir(%q, %q) = %q, want %q", c.serverPath, c.remoteDir, got, c.want)
+		}
+	}
+}
+
+type fakeFileInfo struct {
+	size  int64
+	mtime int64
+}
+
+func (f fakeFileInfo) Name() string       { return "" }
+func (f fakeFileInfo) Size() int64        { return f.size }
+func (f fakeFileInfo) Mode() os.FileMode  { return 0 }
+func (f fakeFileInfo) ModTime() time.Time { return time.Unix(f.mtime, 0) }
+func (f fakeFileInfo) IsDir() bool        { return false }
+func (f fakeFileInfo) Sys() interface{}   { return nil }
+
+func TestDiffSyncManifestDownloadsNewAndChangedFiles(t *testing.T) {
+	manifest := map[string]manifestEntry{
+		"a.txt":     {Path: "a.txt", ServerPath: "photos/a.txt", Size: 10, MTime: 100},
+		"sub/b.txt": {Path: "sub/b.txt", ServerPath: "photos/sub/b.txt", Size: 20, MTime: 200},
+		"same.txt":  {Path: "same.txt", ServerPath: "photos/same.txt", Size: 5, MTime: 300},
+	}
+	local := map[string]os.FileInfo{
+		"a.txt":     fakeFileInfo{size: 999, mtime: 1}, // stale, must re-download
+		"same.txt":  fakeFileInfo{size: 5, mtime: 300}, // up to date
+		"extra.txt": fakeFileInfo{size: 1, mtime: 1},   // not on server
+	}
+
+	toDownload, toDelete := diffSyncManifest(manifest, local, false)
+
+	if len(toDownload) != 2 || toDownload[0] != "a.txt" || toDownload[1] != "sub/b.txt" {
+		t.Fatalf("unexpected toDownload: %v", toDownload)
+	}
+	if len(toDelete) != 0 {
+		t.Fatalf("expected no deletions when delete=false, got %v", toDelete)
+	}
+}
+
+func TestDiffSyncManifestDeletesOnlyWhenRequested(t *testing.T) {
+	manifest := map[string]manifestEntry{
+		"keep.txt": {Path: "keep.txt", Size: 1, MTime: 1},
+	}
+	local := map[string]os.FileInfo{
+		"keep.txt":  fakeFileInfo{size: 1, mtime: 1},
+		"extra.txt": fakeFileInfo{size: 1, mtime: 1},
+	}
+
+	_, toDelete := diffSyncManifest(manifest, local, true)
+	if len(toDelete) != 1 || toDelete[0] != "extra.txt" {
+		t.Fatalf("expected [extra.txt], got %v", toDelete)
+	}
+}
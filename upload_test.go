@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestWriteChunkAtWritesAtOffset(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "chunk-*.part")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	defer f.Close()
+
+	if err := f.Truncate(10); err != nil {
+		t.Fatalf("failed to truncate temp file: %v", err)
+	}
+
+	written, err := writeChunkAt(f, bytes.NewReader([]byte("hello")), 5)
+	if err != nil {
+		t.Fatalf("writeChunkAt returned unexpected error: %v", err)
+	}
+	if written != 5 {
+		t.Fatalf("expected 5 bytes written, got %d", written)
+	}
+
+	got := make([]byte, 10)
+	if _, err := f.ReadAt(got, 0); err != nil {
+		t.Fatalf("failed to read back temp file: %v", err)
+	}
+	want := append(make([]byte, 5), []byte("hello")...)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("file contents = %q, want %q", got, want)
+	}
+}